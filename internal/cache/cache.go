@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"sync"
+)
+
+// Item закэшированный оригинал изображения вместе с метаданными ответа origin-сервера,
+// нужными для последующих условных запросов.
+type Item struct {
+	Bytes        []byte
+	ETag         string
+	LastModified string
+	ContentType  string
+}
+
+// LRUCache простой потокобезопасный LRU-кэш изображений в памяти.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type entry struct {
+	key   string
+	value *Item
+}
+
+// NewLRUCache создаёт кэш с заданной ёмкостью (максимальное число элементов).
+// capacity <= 0 означает неограниченный кэш.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get возвращает закэшированный элемент по ключу. Если данных нет, возвращает os.ErrNotExist.
+func (c *LRUCache) Get(_ context.Context, key string) (*Item, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	c.order.MoveToFront(el)
+
+	return el.Value.(*entry).value, nil
+}
+
+// Set сохраняет элемент в кэше, вытесняя наименее востребованную запись при превышении ёмкости.
+func (c *LRUCache) Set(_ context.Context, key string, item *Item) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		el.Value.(*entry).value = item
+		return nil
+	}
+
+	el := c.order.PushFront(&entry{key: key, value: item})
+	c.items[key] = el
+
+	if c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*entry).key)
+		}
+	}
+
+	return nil
+}
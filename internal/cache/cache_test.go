@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache_GetMiss(t *testing.T) {
+	c := NewLRUCache(2)
+
+	_, err := c.Get(context.Background(), "missing")
+	require.True(t, errors.Is(err, os.ErrNotExist), "expected os.ErrNotExist for a missing key")
+}
+
+func TestLRUCache_SetAndGet(t *testing.T) {
+	c := NewLRUCache(2)
+	item := &Item{Bytes: []byte("a"), ETag: `"a"`}
+
+	require.NoError(t, c.Set(context.Background(), "a", item))
+
+	got, err := c.Get(context.Background(), "a")
+	require.NoError(t, err)
+	require.Same(t, item, got)
+}
+
+func TestLRUCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRUCache(2)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "a", &Item{Bytes: []byte("a")}))
+	require.NoError(t, c.Set(ctx, "b", &Item{Bytes: []byte("b")}))
+
+	// Обращение к "a" делает его более свежим, чем "b".
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+
+	require.NoError(t, c.Set(ctx, "c", &Item{Bytes: []byte("c")}))
+
+	// "b" вытеснен как наименее востребованный, "a" и "c" остались.
+	_, err = c.Get(ctx, "b")
+	require.True(t, errors.Is(err, os.ErrNotExist), "expected \"b\" to be evicted")
+
+	_, err = c.Get(ctx, "a")
+	require.NoError(t, err, "expected \"a\" to survive eviction")
+
+	_, err = c.Get(ctx, "c")
+	require.NoError(t, err, "expected \"c\" to be present")
+}
+
+func TestLRUCache_SetExistingKeyDoesNotEvict(t *testing.T) {
+	c := NewLRUCache(2)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "a", &Item{Bytes: []byte("a1")}))
+	require.NoError(t, c.Set(ctx, "b", &Item{Bytes: []byte("b")}))
+	require.NoError(t, c.Set(ctx, "a", &Item{Bytes: []byte("a2")}))
+
+	got, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, []byte("a2"), got.Bytes, "expected Set on an existing key to update its value")
+
+	_, err = c.Get(ctx, "b")
+	require.NoError(t, err, "expected \"b\" to still be present")
+}
+
+func TestLRUCache_ZeroCapacityIsUnbounded(t *testing.T) {
+	c := NewLRUCache(0)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.Set(ctx, string(rune('a'+i)), &Item{Bytes: []byte{byte(i)}}))
+	}
+
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err, "expected capacity <= 0 to mean unbounded cache")
+}
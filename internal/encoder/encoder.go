@@ -0,0 +1,96 @@
+// Package encoder содержит реализации кодирования результирующего изображения в разные форматы
+// и согласование формата вывода по заголовку Accept.
+package encoder
+
+import (
+	"image"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoder кодирует изображение в конкретный выходной формат.
+type Encoder interface {
+	// Name короткое имя формата, используемое в ключах кэша и в параметре ?format=.
+	Name() string
+	// ContentType MIME-тип, отдаваемый в заголовке Content-Type.
+	ContentType() string
+	Encode(w io.Writer, img image.Image) error
+}
+
+// DefaultFormat формат, используемый, когда клиент не просил ничего конкретного.
+const DefaultFormat = "jpeg"
+
+var (
+	byName = map[string]Encoder{}
+	byMIME = map[string]string{}
+)
+
+// Register регистрирует кодировщик под его именем и MIME-типом.
+func Register(e Encoder) {
+	byName[e.Name()] = e
+	byMIME[e.ContentType()] = e.Name()
+}
+
+// ByName возвращает зарегистрированный кодировщик по имени формата.
+func ByName(name string) (Encoder, bool) {
+	e, ok := byName[name]
+	return e, ok
+}
+
+type acceptEntry struct {
+	mime string
+	q    float64
+}
+
+// Negotiate выбирает формат вывода. Явный override (параметр ?format=) имеет приоритет над
+// заголовком Accept; значения Accept сортируются по q и сопоставляются с зарегистрированными
+// MIME-типами, первое совпадение побеждает. Если ничего не подошло, возвращается DefaultFormat.
+func Negotiate(acceptHeader, override string) string {
+	if override != "" {
+		if _, ok := byName[override]; ok {
+			return override
+		}
+	}
+
+	entries := parseAccept(acceptHeader)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	for _, e := range entries {
+		if e.mime == "*/*" || e.mime == "image/*" {
+			return DefaultFormat
+		}
+		if name, ok := byMIME[e.mime]; ok {
+			return name
+		}
+	}
+
+	return DefaultFormat
+}
+
+func parseAccept(header string) []acceptEntry {
+	var entries []acceptEntry
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		segments := strings.Split(part, ";")
+		mime := strings.TrimSpace(segments[0])
+		q := 1.0
+		for _, seg := range segments[1:] {
+			seg = strings.TrimSpace(seg)
+			if v, ok := strings.CutPrefix(seg, "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		entries = append(entries, acceptEntry{mime: mime, q: q})
+	}
+
+	return entries
+}
@@ -0,0 +1,80 @@
+package encoder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate_OverrideTakesPriority(t *testing.T) {
+	require.Equal(t, "png", Negotiate("image/jpeg", "png"))
+}
+
+func TestNegotiate_UnknownOverrideFallsBackToAccept(t *testing.T) {
+	require.Equal(t, "png", Negotiate("image/png", "unknown-format"))
+}
+
+func TestNegotiate_PicksHighestQValue(t *testing.T) {
+	require.Equal(t, "png", Negotiate("image/jpeg;q=0.5, image/png;q=0.9", ""))
+}
+
+func TestNegotiate_WildcardFallsBackToDefault(t *testing.T) {
+	require.Equal(t, DefaultFormat, Negotiate("*/*", ""))
+	require.Equal(t, DefaultFormat, Negotiate("image/*", ""))
+}
+
+func TestNegotiate_NoMatchFallsBackToDefault(t *testing.T) {
+	require.Equal(t, DefaultFormat, Negotiate("text/html", ""))
+}
+
+func TestNegotiate_EmptyAcceptFallsBackToDefault(t *testing.T) {
+	require.Equal(t, DefaultFormat, Negotiate("", ""))
+}
+
+func TestParseAccept(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   []acceptEntry
+	}{
+		{
+			name:   "single entry without q defaults to 1.0",
+			header: "image/png",
+			want:   []acceptEntry{{mime: "image/png", q: 1.0}},
+		},
+		{
+			name:   "explicit q value",
+			header: "image/png;q=0.3",
+			want:   []acceptEntry{{mime: "image/png", q: 0.3}},
+		},
+		{
+			name:   "multiple entries with whitespace",
+			header: "image/jpeg ; q=0.5 , image/png",
+			want: []acceptEntry{
+				{mime: "image/jpeg", q: 0.5},
+				{mime: "image/png", q: 1.0},
+			},
+		},
+		{
+			name:   "malformed q value falls back to 1.0",
+			header: "image/png;q=not-a-number",
+			want:   []acceptEntry{{mime: "image/png", q: 1.0}},
+		},
+		{
+			name:   "empty segments are skipped",
+			header: ",image/png,,",
+			want:   []acceptEntry{{mime: "image/png", q: 1.0}},
+		},
+		{
+			name:   "empty header yields no entries",
+			header: "",
+			want:   nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, parseAccept(tc.header))
+		})
+	}
+}
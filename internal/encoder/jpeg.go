@@ -0,0 +1,23 @@
+package encoder
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// jpegQuality качество JPEG-кодирования, сохранённое из прежнего поведения ImageProcessor.
+const jpegQuality = 85
+
+type jpegEncoder struct{}
+
+func (jpegEncoder) Name() string        { return "jpeg" }
+func (jpegEncoder) ContentType() string { return "image/jpeg" }
+
+func (jpegEncoder) Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
+
+func init() {
+	Register(jpegEncoder{})
+}
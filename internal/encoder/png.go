@@ -0,0 +1,20 @@
+package encoder
+
+import (
+	"image"
+	"image/png"
+	"io"
+)
+
+type pngEncoder struct{}
+
+func (pngEncoder) Name() string        { return "png" }
+func (pngEncoder) ContentType() string { return "image/png" }
+
+func (pngEncoder) Encode(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
+
+func init() {
+	Register(pngEncoder{})
+}
@@ -0,0 +1,28 @@
+package encoder
+
+// Этот файл использует github.com/chai2010/webp, который оборачивает libwebp через cgo. В отличие
+// от остального стека (imaging, prometheus-клиент, testify), сборка и деплой этого пакета требуют
+// CGO_ENABLED=1 и наличия libwebp-dev (или эквивалента) в окружении сборки и в рантайм-образе.
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+// webpQuality качество WebP-кодирования, в тех же рамках, что и JPEG.
+const webpQuality = 85
+
+type webpEncoder struct{}
+
+func (webpEncoder) Name() string        { return "webp" }
+func (webpEncoder) ContentType() string { return "image/webp" }
+
+func (webpEncoder) Encode(w io.Writer, img image.Image) error {
+	return webp.Encode(w, img, &webp.Options{Quality: webpQuality})
+}
+
+func init() {
+	Register(webpEncoder{})
+}
@@ -0,0 +1,89 @@
+// Package metrics содержит счётчики и гистограммы Prometheus для пайплайна ресайза.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Stage обозначает этап пайплайна, на котором произошла ошибка.
+type Stage string
+
+const (
+	StageDownload Stage = "download"
+	StageDecode   Stage = "decode"
+	StageEncode   Stage = "encode"
+	StageCache    Stage = "cache"
+)
+
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Metrics хранит все метрики, собираемые ImageProcessor.
+type Metrics struct {
+	ResizeRequestsTotal *prometheus.CounterVec
+	ResizeDuration      prometheus.Histogram
+	OriginFetchDuration prometheus.Histogram
+	BytesIn             prometheus.Counter
+	BytesOut            prometheus.Counter
+	CacheHitsTotal      prometheus.Counter
+	CacheMissesTotal    prometheus.Counter
+	InFlightResizes     prometheus.Gauge
+}
+
+// New регистрирует метрики в переданном реестре и возвращает их.
+func New(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		ResizeRequestsTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "imgpreview_resize_requests_total",
+			Help: "Total resize requests, partitioned by status and by failure stage (skip reason for skipped requests).",
+		}, []string{"status", "stage"}),
+		ResizeDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "imgpreview_resize_duration_seconds",
+			Help:    "End-to-end duration of resize requests.",
+			Buckets: durationBuckets,
+		}),
+		OriginFetchDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "imgpreview_origin_fetch_duration_seconds",
+			Help:    "Duration of image downloads from the origin server.",
+			Buckets: durationBuckets,
+		}),
+		BytesIn: factory.NewCounter(prometheus.CounterOpts{
+			Name: "imgpreview_bytes_in_total",
+			Help: "Total bytes downloaded from origin servers.",
+		}),
+		BytesOut: factory.NewCounter(prometheus.CounterOpts{
+			Name: "imgpreview_bytes_out_total",
+			Help: "Total bytes of resized images returned to clients.",
+		}),
+		CacheHitsTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "imgpreview_cache_hits_total",
+			Help: "Total number of original-image cache hits.",
+		}),
+		CacheMissesTotal: factory.NewCounter(prometheus.CounterOpts{
+			Name: "imgpreview_cache_misses_total",
+			Help: "Total number of original-image cache misses.",
+		}),
+		InFlightResizes: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "imgpreview_inflight_resizes",
+			Help: "Number of resize operations currently in progress.",
+		}),
+	}
+}
+
+// ObserveSuccess записывает успешный ресайз и его длительность.
+func (m *Metrics) ObserveSuccess(durationSeconds float64) {
+	m.ResizeRequestsTotal.WithLabelValues("success", "").Inc()
+	m.ResizeDuration.Observe(durationSeconds)
+}
+
+// ObserveError записывает ошибку на заданном этапе пайплайна.
+func (m *Metrics) ObserveError(stage Stage) {
+	m.ResizeRequestsTotal.WithLabelValues("error", string(stage)).Inc()
+}
+
+// ObserveSkipped записывает ресайз, пропущенный в пользу прямой трансляции оригинала, с указанием причины.
+func (m *Metrics) ObserveSkipped(reason string) {
+	m.ResizeRequestsTotal.WithLabelValues("skipped", reason).Inc()
+}
@@ -3,27 +3,79 @@ package processor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
+	"io"
 	"net/http"
 	"os"
+	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/grunsh/imgPreview/internal/cache"
+	"github.com/grunsh/imgPreview/internal/encoder"
+	"github.com/grunsh/imgPreview/internal/metrics"
+	"github.com/grunsh/imgPreview/internal/request"
 )
 
+// DefaultCacheControl значение Cache-Control, отдаваемое клиенту по умолчанию.
+const DefaultCacheControl = "public, max-age=86400"
+
+// defaultAcquireTimeout время ожидания свободного слота в семафоре масштабирования по умолчанию.
+const defaultAcquireTimeout = 200 * time.Millisecond
+
+// defaultMaxDecodedBytes бюджет памяти на декодированное изображение по умолчанию (width*height*4),
+// выше которого мы отказываемся от ресайза и отдаём оригинал как есть.
+const defaultMaxDecodedBytes = 64 << 20 // 64 MiB
+
+// bytesPerPixel число байт на пиксель, используемое для оценки памяти под декодированное изображение.
+const bytesPerPixel = 4
+
+// Причины, по которым ресайз был пропущен в пользу прямой трансляции оригинала.
+const (
+	SkipReasonOverloaded = "skipped-overloaded"
+	SkipReasonOversized  = "skipped-oversized"
+)
+
+// ResizeSkipHeader заголовок ответа, сигнализирующий клиенту, что ресайз был пропущен.
+const ResizeSkipHeader = "X-Image-Resize"
+
 // ImageProcessor обработчик изображений.
 type ImageProcessor struct {
-	cache  *cache.LRUCache
-	client *http.Client
+	cache   *cache.LRUCache
+	client  *http.Client
+	metrics *metrics.Metrics
+
+	scalerSem       chan struct{}
+	acquireTimeout  time.Duration
+	maxDecodedBytes uint64
 }
 
-func NewImageProcessor(cache *cache.LRUCache) *ImageProcessor {
+func NewImageProcessor(cache *cache.LRUCache, m *metrics.Metrics) *ImageProcessor {
+	maxProcs := runtime.NumCPU()
+	if v := os.Getenv("MAX_SCALER_PROCS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxProcs = n
+		}
+	}
+	if maxProcs < 1 {
+		maxProcs = 1
+	}
+
+	acquireTimeout := defaultAcquireTimeout
+	if v := os.Getenv("SCALER_ACQUIRE_TIMEOUT_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			acquireTimeout = time.Duration(n) * time.Millisecond
+		}
+	}
+
 	return &ImageProcessor{
-		cache: cache,
+		cache:   cache,
+		metrics: m,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 			// Добавляем Transport с безопасными настройками
@@ -31,32 +83,126 @@ func NewImageProcessor(cache *cache.LRUCache) *ImageProcessor {
 				DisableKeepAlives: true,
 			},
 		},
+		scalerSem:       make(chan struct{}, maxProcs),
+		acquireTimeout:  acquireTimeout,
+		maxDecodedBytes: defaultMaxDecodedBytes,
 	}
 }
 
-type OriginalImageResponse struct {
-	Image   image.Image
-	Headers http.Header
-}
-
-func (p *ImageProcessor) GetOriginalImage(ctx context.Context, url string) (*OriginalImageResponse, error) {
+// fetchOriginal возвращает сырые байты оригинального изображения (из кэша или от origin-сервера)
+// вместе с заголовками ответа, не декодируя их. Декодирование откладывается до тех пор, пока мы не
+// убедимся, что изображение укладывается в бюджет памяти и стоит его масштабировать.
+func (p *ImageProcessor) fetchOriginal(ctx context.Context, url string) ([]byte, http.Header, error) {
 	// Ключ кэша - только URL без размеров
 	cacheKey := url
 
 	// Пытаемся получить из кэша
-	cachedData, err := p.cache.Get(ctx, cacheKey)
+	cached, err := p.cache.Get(ctx, cacheKey)
 	if err == nil {
-		defer cachedData.Close()
-		img, _, err := image.Decode(cachedData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode cached image: %w", err)
-		}
-		return &OriginalImageResponse{Image: img}, nil
+		p.metrics.CacheHitsTotal.Inc()
+		return p.revalidateOrigin(ctx, cacheKey, cached)
 	} else if !errors.Is(err, os.ErrNotExist) {
-		return nil, fmt.Errorf("failed to get from cache: %w", err)
+		return nil, nil, fmt.Errorf("failed to get from cache: %w", err)
+	}
+	p.metrics.CacheMissesTotal.Inc()
+
+	resp, err := p.doOriginRequest(ctx, url, nil)
+	if err != nil {
+		p.metrics.ObserveError(metrics.StageDownload)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		p.metrics.ObserveError(metrics.StageDownload)
+		return nil, nil, fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		p.metrics.ObserveError(metrics.StageDownload)
+		return nil, nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	p.metrics.BytesIn.Add(float64(len(raw)))
+
+	// Сохраняем оригинал в кэш вместе с метаданными, нужными для условных запросов
+	item := &cache.Item{
+		Bytes:        raw,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+	}
+	if err := p.cache.Set(ctx, cacheKey, item); err != nil {
+		p.metrics.ObserveError(metrics.StageCache)
+		return nil, nil, fmt.Errorf("failed to cache image: %w", err)
+	}
+
+	return raw, resp.Header, nil
+}
+
+// revalidateOrigin проверяет закэшированный оригинал на актуальность условным запросом к
+// origin-серверу (If-None-Match/If-Modified-Since из закэшированных метаданных). 304 или
+// недоступность origin означают, что мы используем закэшированные байты как есть; 200 означает,
+// что origin отдал новую версию - обновляем кэш и используем её.
+func (p *ImageProcessor) revalidateOrigin(ctx context.Context, cacheKey string, cached *cache.Item) ([]byte, http.Header, error) {
+	resp, err := p.doOriginRequest(ctx, cacheKey, cached)
+	if err != nil {
+		// Origin недоступен для ревалидации - отдаём то, что уже есть в кэше, а не падаем целиком.
+		p.metrics.ObserveError(metrics.StageDownload)
+		return cached.Bytes, headersFromItem(cached), nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return cached.Bytes, headersFromItem(cached), nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		p.metrics.ObserveError(metrics.StageDownload)
+		return cached.Bytes, headersFromItem(cached), nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		p.metrics.ObserveError(metrics.StageDownload)
+		return nil, nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	p.metrics.BytesIn.Add(float64(len(raw)))
+
+	item := &cache.Item{
+		Bytes:        raw,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
 	}
+	if err := p.cache.Set(ctx, cacheKey, item); err != nil {
+		p.metrics.ObserveError(metrics.StageCache)
+		return nil, nil, fmt.Errorf("failed to cache image: %w", err)
+	}
+
+	return raw, resp.Header, nil
+}
 
-	// Если в кэше нет, скачиваем изображение
+// headersFromItem восстанавливает заголовки ответа origin-сервера из закэшированных метаданных.
+func headersFromItem(item *cache.Item) http.Header {
+	headers := make(http.Header)
+	if item.ETag != "" {
+		headers.Set("ETag", item.ETag)
+	}
+	if item.LastModified != "" {
+		headers.Set("Last-Modified", item.LastModified)
+	}
+	if item.ContentType != "" {
+		headers.Set("Content-Type", item.ContentType)
+	}
+	return headers
+}
+
+// doOriginRequest выполняет GET-запрос к origin-серверу, предварительно проверяя доступность HTTPS
+// через HEAD и откатываясь на HTTP, если он недоступен. Если cached задан, запрос становится
+// условным (If-None-Match/If-Modified-Since из закэшированных метаданных), чтобы origin мог
+// ответить 304 и не пересылать тело повторно.
+func (p *ImageProcessor) doOriginRequest(ctx context.Context, url string, cached *cache.Item) (*http.Response, error) {
 	httpsURL := "https://" + url
 	req, err := http.NewRequestWithContext(ctx, "HEAD", httpsURL, nil)
 	if err != nil {
@@ -81,54 +227,200 @@ func (p *ImageProcessor) GetOriginalImage(ctx context.Context, url string) (*Ori
 		}
 	}
 
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
 	// Выполняем основной запрос
+	fetchStart := time.Now()
 	resp, err = p.client.Do(req)
+	p.metrics.OriginFetchDuration.Observe(time.Since(fetchStart).Seconds())
 	if err != nil {
 		return nil, fmt.Errorf("failed to download image: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status: %d", resp.StatusCode)
+	return resp, nil
+}
+
+// ProcessResult результат обработки запроса вместе с данными, нужными для условных запросов клиента.
+type ProcessResult struct {
+	Data         []byte
+	Headers      http.Header
+	ContentType  string
+	ETag         string
+	LastModified string
+	CacheControl string
+	// SkipReason не пуст, если ресайз был пропущен и клиенту отдан оригинал как есть.
+	SkipReason string
+	// NotModified true, если запрос прошёл условную проверку клиента (If-None-Match /
+	// If-Modified-Since) и дальше дело до декодирования/ресайза не дошло — Data и ContentType пусты.
+	NotModified bool
+}
+
+// ProcessImage обрабатывает запрос на ресайз. notModified, если задан, вызывается сразу после того,
+// как становятся известны ETag и Last-Modified (до проверки бюджета памяти, захвата семафора
+// масштабирования и самого декодирования), чтобы условные запросы клиента не платили за работу,
+// результат которой всё равно будет отброшен.
+func (p *ImageProcessor) ProcessImage(ctx context.Context, req *request.Request, format string, notModified func(etag, lastModified string) bool) (*ProcessResult, error) {
+	start := time.Now()
+
+	enc, ok := encoder.ByName(format)
+	if !ok {
+		enc, _ = encoder.ByName(encoder.DefaultFormat)
+		format = encoder.DefaultFormat
 	}
 
-	// Декодируем изображение
-	img, _, err := image.Decode(resp.Body)
+	raw, headers, err := p.fetchOriginal(ctx, req.OriginURL)
 	if err != nil {
+		return nil, err
+	}
+
+	originToken := headers.Get("ETag")
+	if originToken == "" {
+		originToken = headers.Get("Last-Modified")
+	}
+	etag := computeETag(req, format, originToken)
+	lastModified := headers.Get("Last-Modified")
+	cacheControl := cacheControlFor(headers)
+
+	if notModified != nil && notModified(etag, lastModified) {
+		return &ProcessResult{
+			ETag:         etag,
+			LastModified: lastModified,
+			CacheControl: cacheControl,
+			NotModified:  true,
+		}, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		p.metrics.ObserveError(metrics.StageDecode)
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Сохраняем оригинал в кэш
-	var buf bytes.Buffer
-	if err := imaging.Encode(&buf, img, imaging.JPEG); err != nil {
-		return nil, fmt.Errorf("failed to encode image for cache: %w", err)
+	if estimatedBytes := uint64(cfg.Width) * uint64(cfg.Height) * bytesPerPixel; estimatedBytes > p.maxDecodedBytes {
+		p.metrics.ObserveSkipped(SkipReasonOversized)
+		return p.passthrough(raw, headers, etag, lastModified, cacheControl, SkipReasonOversized), nil
 	}
 
-	if err := p.cache.Set(ctx, cacheKey, buf.Bytes()); err != nil {
-		return nil, fmt.Errorf("failed to cache image: %w", err)
+	select {
+	case p.scalerSem <- struct{}{}:
+		defer func() { <-p.scalerSem }()
+	case <-time.After(p.acquireTimeout):
+		p.metrics.ObserveSkipped(SkipReasonOverloaded)
+		return p.passthrough(raw, headers, etag, lastModified, cacheControl, SkipReasonOverloaded), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 
-	return &OriginalImageResponse{
-		Image:   img,
-		Headers: resp.Header,
-	}, nil
-}
+	p.metrics.InFlightResizes.Inc()
+	defer p.metrics.InFlightResizes.Dec()
 
-func (p *ImageProcessor) ProcessImage(ctx context.Context, url string, width, height int) ([]byte, http.Header, error) {
-	// Получаем оригинальное изображение (из кэша или скачиваем)
-	resp, err := p.GetOriginalImage(ctx, url)
+	img, _, err := image.Decode(bytes.NewReader(raw))
 	if err != nil {
-		return nil, nil, err
+		p.metrics.ObserveError(metrics.StageDecode)
+		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
-	// Масштабируем изображение с использованием библиотеки imaging
-	resizedImg := imaging.Resize(resp.Image, width, height, imaging.Lanczos)
+	resizedImg := resize(img, req)
 
-	// Кодируем в JPEG
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, resizedImg, &jpeg.Options{Quality: 85}); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode image: %w", err)
+	if err := enc.Encode(&buf, resizedImg); err != nil {
+		p.metrics.ObserveError(metrics.StageEncode)
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	p.metrics.BytesOut.Add(float64(buf.Len()))
+	p.metrics.ObserveSuccess(time.Since(start).Seconds())
+
+	return &ProcessResult{
+		Data:         buf.Bytes(),
+		Headers:      headers,
+		ContentType:  enc.ContentType(),
+		ETag:         etag,
+		LastModified: lastModified,
+		CacheControl: cacheControl,
+	}, nil
+}
+
+// passthrough возвращает оригинальные байты без ресайза, помечая ответ заголовком ResizeSkipHeader.
+func (p *ImageProcessor) passthrough(raw []byte, headers http.Header, etag, lastModified, cacheControl, reason string) *ProcessResult {
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
 	}
 
-	return buf.Bytes(), resp.Headers, nil
+	return &ProcessResult{
+		Data:         raw,
+		Headers:      headers,
+		ContentType:  contentType,
+		ETag:         etag,
+		LastModified: lastModified,
+		CacheControl: cacheControl,
+		SkipReason:   reason,
+	}
+}
+
+// cacheControlFor отдаёт Cache-Control оригинала, если origin-сервер его прислал, и DefaultCacheControl
+// в противном случае, вместо того чтобы всегда подменять значение origin-сервера своим.
+func cacheControlFor(headers http.Header) string {
+	if cc := headers.Get("Cache-Control"); cc != "" {
+		return cc
+	}
+	return DefaultCacheControl
+}
+
+// computeETag строит сильный ETag из URL, режима ресайза, гравитации, запрошенных размеров,
+// формата вывода и идентификатора origin-версии (ETag или Last-Modified оригинала), чтобы разные
+// варианты одной картинки (размеры, режим, гравитация, формат) не путались друг с другом.
+func computeETag(req *request.Request, format, originToken string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%s|%s|%s",
+		req.OriginURL, req.Op, req.Width, req.Height, req.Gravity, format, originToken)))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// resize применяет операцию ресайза, соответствующую req.Op.
+func resize(img image.Image, req *request.Request) image.Image {
+	switch req.Op {
+	case request.OpFit:
+		return imaging.Fit(img, req.Width, req.Height, imaging.Lanczos)
+	case request.OpThumbnail:
+		return imaging.Thumbnail(img, req.Width, req.Height, imaging.Lanczos)
+	case request.OpCrop:
+		// imaging.Fill сначала масштабирует изображение так, чтобы оно полностью покрывало
+		// запрошенный бокс, и только потом обрезает его по якорю — иначе для оригинала крупнее
+		// запрошенных размеров CropAnchor вырезал бы нативный по разрешению кусок из середины кадра.
+		return imaging.Fill(img, req.Width, req.Height, anchorFor(req.Gravity), imaging.Lanczos)
+	default: // request.OpFill
+		return imaging.Resize(img, req.Width, req.Height, imaging.Lanczos)
+	}
+}
+
+// anchorFor сопоставляет гравитацию запроса с якорем обрезки imaging.
+func anchorFor(g request.Gravity) imaging.Anchor {
+	switch g {
+	case request.GravityNorth:
+		return imaging.Top
+	case request.GravitySouth:
+		return imaging.Bottom
+	case request.GravityEast:
+		return imaging.Right
+	case request.GravityWest:
+		return imaging.Left
+	case request.GravityNE:
+		return imaging.TopRight
+	case request.GravityNW:
+		return imaging.TopLeft
+	case request.GravitySE:
+		return imaging.BottomRight
+	case request.GravitySW:
+		return imaging.BottomLeft
+	default:
+		return imaging.Center
+	}
 }
@@ -0,0 +1,119 @@
+// Package request разбирает путь HTTP-запроса на ресайз изображения в типизированную структуру.
+package request
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Op режим ресайза, соответствующий первому сегменту пути.
+type Op string
+
+const (
+	OpFill      Op = "fill"
+	OpFit       Op = "fit"
+	OpThumbnail Op = "thumbnail"
+	OpCrop      Op = "crop"
+)
+
+// Gravity точка привязки для режима OpCrop.
+type Gravity string
+
+const (
+	GravityCenter Gravity = "center"
+	GravityNorth  Gravity = "north"
+	GravitySouth  Gravity = "south"
+	GravityEast   Gravity = "east"
+	GravityWest   Gravity = "west"
+	GravityNE     Gravity = "ne"
+	GravityNW     Gravity = "nw"
+	GravitySE     Gravity = "se"
+	GravitySW     Gravity = "sw"
+)
+
+// Valid сообщает, является ли g одним из поддерживаемых значений гравитации.
+func (g Gravity) Valid() bool {
+	switch g {
+	case GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityNE, GravityNW, GravitySE, GravitySW:
+		return true
+	default:
+		return false
+	}
+}
+
+// Request разобранный запрос на ресайз изображения.
+type Request struct {
+	Op        Op
+	Width     int
+	Height    int
+	Gravity   Gravity
+	OriginURL string
+}
+
+// Parse разбирает путь вида /{op}/{width}/{height}/{url} (или /crop/{width}/{height}/{gravity}/{url})
+// в типизированную структуру Request.
+func Parse(path string) (*Request, error) {
+	path = strings.TrimPrefix(path, "/")
+	segments := strings.SplitN(path, "/", 2)
+	if len(segments) != 2 || segments[1] == "" {
+		return nil, fmt.Errorf("invalid request path")
+	}
+
+	op := Op(segments[0])
+	switch op {
+	case OpFill, OpFit, OpThumbnail:
+		return parseSimple(op, segments[1])
+	case OpCrop:
+		return parseCrop(segments[1])
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", segments[0])
+	}
+}
+
+func parseSimple(op Op, rest string) (*Request, error) {
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid request path")
+	}
+
+	width, height, err := parseDimensions(parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Request{Op: op, Width: width, Height: height, Gravity: GravityCenter, OriginURL: parts[2]}, nil
+}
+
+func parseCrop(rest string) (*Request, error) {
+	parts := strings.SplitN(rest, "/", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid request path")
+	}
+
+	width, height, err := parseDimensions(parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	gravity := Gravity(parts[2])
+	if !gravity.Valid() {
+		return nil, fmt.Errorf("invalid gravity: %s", parts[2])
+	}
+
+	return &Request{Op: OpCrop, Width: width, Height: height, Gravity: gravity, OriginURL: parts[3]}, nil
+}
+
+func parseDimensions(widthStr, heightStr string) (int, int, error) {
+	width, err := strconv.Atoi(widthStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width: %w", err)
+	}
+
+	height, err := strconv.Atoi(heightStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid height: %w", err)
+	}
+
+	return width, height, nil
+}
@@ -0,0 +1,93 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Simple(t *testing.T) {
+	cases := []struct {
+		op   Op
+		path string
+	}{
+		{OpFill, "/fill/300/200/example.com/img.jpg"},
+		{OpFit, "/fit/300/200/example.com/img.jpg"},
+		{OpThumbnail, "/thumbnail/300/200/example.com/img.jpg"},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.op), func(t *testing.T) {
+			req, err := Parse(tc.path)
+			require.NoError(t, err)
+			require.Equal(t, tc.op, req.Op)
+			require.Equal(t, 300, req.Width)
+			require.Equal(t, 200, req.Height)
+			require.Equal(t, GravityCenter, req.Gravity)
+			require.Equal(t, "example.com/img.jpg", req.OriginURL)
+		})
+	}
+}
+
+func TestParse_Crop(t *testing.T) {
+	req, err := Parse("/crop/300/200/nw/example.com/img.jpg")
+	require.NoError(t, err)
+	require.Equal(t, OpCrop, req.Op)
+	require.Equal(t, 300, req.Width)
+	require.Equal(t, 200, req.Height)
+	require.Equal(t, GravityNW, req.Gravity)
+	require.Equal(t, "example.com/img.jpg", req.OriginURL)
+}
+
+func TestParse_CropInvalidGravity(t *testing.T) {
+	_, err := Parse("/crop/300/200/somewhere/example.com/img.jpg")
+	require.Error(t, err)
+}
+
+func TestParse_UnsupportedOperation(t *testing.T) {
+	_, err := Parse("/rotate/300/200/example.com/img.jpg")
+	require.Error(t, err)
+}
+
+func TestParse_InvalidPath(t *testing.T) {
+	cases := []string{
+		"",
+		"/",
+		"/fill",
+		"/fill/300",
+	}
+
+	for _, path := range cases {
+		t.Run(path, func(t *testing.T) {
+			_, err := Parse(path)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParse_InvalidDimensions(t *testing.T) {
+	cases := []string{
+		"/fill/abc/200/example.com/img.jpg",
+		"/fill/300/abc/example.com/img.jpg",
+	}
+
+	for _, path := range cases {
+		t.Run(path, func(t *testing.T) {
+			_, err := Parse(path)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestGravity_Valid(t *testing.T) {
+	valid := []Gravity{
+		GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest,
+		GravityNE, GravityNW, GravitySE, GravitySW,
+	}
+	for _, g := range valid {
+		require.True(t, g.Valid(), "expected %q to be valid", g)
+	}
+
+	require.False(t, Gravity("diagonal").Valid())
+	require.False(t, Gravity("").Valid())
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/grunsh/imgPreview/internal/encoder"
+	"github.com/grunsh/imgPreview/internal/processor"
+	"github.com/grunsh/imgPreview/internal/request"
+)
+
+// handlerOwnedHeaders заголовки, которые не копируются из «сырых» заголовков ответа origin-сервера
+// (result.Headers): Content-Type, ETag, Last-Modified и Cache-Control обработчик вычисляет и
+// выставляет сам, а Content-Length, Transfer-Encoding и Connection описывают соединение с origin
+// и для ответа клиенту выставляются net/http.
+var handlerOwnedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Etag":              true,
+	"Last-Modified":     true,
+	"Cache-Control":     true,
+}
+
+// newResizeHandler создаёт http.HandlerFunc, обслуживающий маршруты /fill, /fit, /thumbnail и /crop.
+func newResizeHandler(p *processor.ImageProcessor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := request.Parse(r.URL.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		format := encoder.Negotiate(r.Header.Get("Accept"), r.URL.Query().Get("format"))
+
+		result, err := p.ProcessImage(r.Context(), req, format, func(etag, lastModified string) bool {
+			return notModified(r, etag, lastModified)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Vary", "Accept")
+		w.Header().Set("ETag", result.ETag)
+		w.Header().Set("Cache-Control", result.CacheControl)
+		if result.LastModified != "" {
+			w.Header().Set("Last-Modified", result.LastModified)
+		}
+
+		if result.NotModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		for key, values := range result.Headers {
+			if handlerOwnedHeaders[http.CanonicalHeaderKey(key)] {
+				continue
+			}
+			for _, v := range values {
+				w.Header().Add(key, v)
+			}
+		}
+		if result.SkipReason != "" {
+			w.Header().Set(processor.ResizeSkipHeader, result.SkipReason)
+		}
+
+		w.Header().Set("Content-Type", result.ContentType)
+		w.Write(result.Data)
+	}
+}
+
+// notModified проверяет заголовки If-None-Match и If-Modified-Since запроса против
+// текущего ETag/Last-Modified ответа.
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && lastModified != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(lastModified)
+		if err != nil {
+			return false
+		}
+		return !modified.After(since)
+	}
+
+	return false
+}
+
+// etagMatches проверяет ETag ответа против списка значений из If-None-Match,
+// который может содержать "*" или несколько значений через запятую.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -11,6 +11,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,6 +62,12 @@ func TestIntegration(t *testing.T) {
 	testRemoteServerError(t)
 	testSmallImageResizing(t)
 	testHeaderForwarding(t)
+	testConditionalRequest(t)
+	testOriginRevalidation(t)
+	testOversizedImagePassthrough(t)
+	testFormatNegotiation(t)
+	testResizeModes(t)
+	testMetricsObservability(t)
 }
 
 func checkDockerImageExists(t *testing.T) {
@@ -427,5 +435,286 @@ func testHeaderForwarding(t *testing.T) {
 		require.Equal(t, "public, max-age=3600", resp.Header.Get("Cache-Control"), "Cache-Control header not forwarded")
 		require.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", resp.Header.Get("Last-Modified"),
 			"Last-Modified header not forwarded")
+		require.NotEmpty(t, resp.Header.Get("ETag"), "ETag header not set")
 	})
 }
+
+func testConditionalRequest(t *testing.T) {
+	t.Helper()
+	t.Run("Conditional GET returns 304 when ETag matches", func(t *testing.T) {
+		client := http.Client{Timeout: 5 * time.Second}
+		url := fmt.Sprintf("http://localhost:%s/fill/300/200/localhost:%s/images/%s",
+			appPort, nginxPort, testImageName)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		require.NoError(t, err, "Failed to create first request")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err, "First request failed")
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag, "ETag header not set on first response")
+
+		ctx2, cancel2 := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel2()
+
+		req2, err := http.NewRequestWithContext(ctx2, "GET", url, nil)
+		require.NoError(t, err, "Failed to create conditional request")
+		req2.Header.Set("If-None-Match", etag)
+
+		resp2, err := client.Do(req2)
+		require.NoError(t, err, "Conditional request failed")
+		defer resp2.Body.Close()
+
+		require.Equal(t, http.StatusNotModified, resp2.StatusCode, "Unexpected status code")
+		body, err := io.ReadAll(resp2.Body)
+		require.NoError(t, err, "Failed to read response body")
+		require.Empty(t, body, "304 response should have no body")
+	})
+}
+
+func testOriginRevalidation(t *testing.T) {
+	t.Helper()
+	t.Run("Cached original is revalidated against origin with a conditional GET", func(t *testing.T) {
+		var requestCount int
+		const originETag = `"origin-etag-v1"`
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestCount++
+			if requestCount > 1 {
+				require.Equal(t, originETag, r.Header.Get("If-None-Match"),
+					"revalidation request should carry the cached ETag")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+			var buf bytes.Buffer
+			require.NoError(t, jpeg.Encode(&buf, img, nil))
+			w.Header().Set("ETag", originETag)
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(buf.Bytes())
+		}))
+		defer server.Close()
+
+		client := http.Client{Timeout: 5 * time.Second}
+		url := fmt.Sprintf("http://localhost:%s/fill/300/200/%s/revalidate.jpg",
+			appPort, server.URL[len("http://"):])
+
+		for i := 0; i < 2; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			require.NoError(t, err, "Failed to create request")
+
+			resp, err := client.Do(req)
+			require.NoError(t, err, "Request failed")
+			require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err, "Failed to read response body")
+			cancel()
+		}
+
+		require.Equal(t, 2, requestCount, "expected origin to be hit on both the initial fetch and the revalidation")
+	})
+}
+
+func testOversizedImagePassthrough(t *testing.T) {
+	t.Helper()
+	t.Run("Image over the decode budget is streamed through unchanged", func(t *testing.T) {
+		// Изображение 5000x5000 заведомо превышает бюджет декодирования по умолчанию (64 MiB).
+		img := image.NewGray(image.Rect(0, 0, 5000, 5000))
+		var original bytes.Buffer
+		require.NoError(t, jpeg.Encode(&original, img, nil))
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(original.Bytes())
+		}))
+		defer server.Close()
+
+		client := http.Client{Timeout: 10 * time.Second}
+		url := fmt.Sprintf("http://localhost:%s/fill/300/200/%s/huge.jpg",
+			appPort, server.URL[len("http://"):])
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		require.NoError(t, err, "Failed to create request")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err, "Request failed")
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+		require.Equal(t, "skipped-oversized", resp.Header.Get("X-Image-Resize"), "Expected resize to be skipped")
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err, "Failed to read response body")
+		require.Equal(t, original.Bytes(), body, "Passthrough body should match the original bytes")
+	})
+}
+
+func testFormatNegotiation(t *testing.T) {
+	t.Helper()
+
+	cases := []struct {
+		name        string
+		accept      string
+		formatParam string
+		contentType string
+		magicPrefix []byte
+	}{
+		{name: "PNG via Accept header", accept: "image/png", contentType: "image/png", magicPrefix: []byte{0x89, 'P', 'N', 'G'}},
+		{name: "WebP via Accept header", accept: "image/webp,image/*;q=0.5", contentType: "image/webp", magicPrefix: []byte("RIFF")},
+		{name: "WebP via format override", accept: "image/png", formatParam: "webp", contentType: "image/webp", magicPrefix: []byte("RIFF")},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := http.Client{Timeout: 5 * time.Second}
+			url := fmt.Sprintf("http://localhost:%s/fill/300/200/localhost:%s/images/%s",
+				appPort, nginxPort, testImageName)
+			if tc.formatParam != "" {
+				url += "?format=" + tc.formatParam
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			require.NoError(t, err, "Failed to create request")
+			req.Header.Set("Accept", tc.accept)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err, "Request failed")
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+			require.Equal(t, tc.contentType, resp.Header.Get("Content-Type"), "Unexpected content type")
+			require.Equal(t, "Accept", resp.Header.Get("Vary"), "Expected Vary: Accept")
+
+			imgData, err := io.ReadAll(resp.Body)
+			require.NoError(t, err, "Failed to read response body")
+			require.True(t, bytes.HasPrefix(imgData, tc.magicPrefix), "Unexpected magic bytes for %s", tc.contentType)
+
+			if tc.contentType == "image/webp" {
+				require.Equal(t, []byte("WEBP"), imgData[8:12], "Missing WEBP fourcc")
+			}
+		})
+	}
+}
+
+func testResizeModes(t *testing.T) {
+	t.Helper()
+
+	cases := []struct {
+		name      string
+		path      string
+		exactSize bool
+	}{
+		{name: "fit", path: "/fit/300/200", exactSize: false},
+		{name: "thumbnail", path: "/thumbnail/300/200", exactSize: true},
+		{name: "crop center", path: "/crop/300/200/center", exactSize: true},
+		{name: "crop north-west", path: "/crop/300/200/nw", exactSize: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := http.Client{Timeout: 5 * time.Second}
+			url := fmt.Sprintf("http://localhost:%s%s/localhost:%s/images/%s",
+				appPort, tc.path, nginxPort, testImageName)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+			require.NoError(t, err, "Failed to create request")
+
+			resp, err := client.Do(req)
+			require.NoError(t, err, "Request failed")
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+
+			imgData, err := io.ReadAll(resp.Body)
+			require.NoError(t, err, "Failed to read response body")
+
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(imgData))
+			require.NoError(t, err, "Failed to decode response image config")
+
+			if tc.exactSize {
+				require.Equal(t, 300, cfg.Width, "Unexpected output width")
+				require.Equal(t, 200, cfg.Height, "Unexpected output height")
+			} else {
+				require.LessOrEqual(t, cfg.Width, 300, "Unexpected output width")
+				require.LessOrEqual(t, cfg.Height, 200, "Unexpected output height")
+			}
+		})
+	}
+}
+
+func testMetricsObservability(t *testing.T) {
+	t.Helper()
+	t.Run("Resize pipeline is observable via /metrics", func(t *testing.T) {
+		client := http.Client{Timeout: 5 * time.Second}
+		metricsURL := fmt.Sprintf("http://localhost:%s/metrics", appPort)
+
+		before := fetchMetricValue(t, client, metricsURL, "imgpreview_resize_requests_total")
+
+		resizeURL := fmt.Sprintf("http://localhost:%s/fill/300/200/localhost:%s/images/%s",
+			appPort, nginxPort, testImageName)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", resizeURL, nil)
+		require.NoError(t, err, "Failed to create request")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err, "Request failed")
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected status code")
+
+		after := fetchMetricValue(t, client, metricsURL, "imgpreview_resize_requests_total")
+		require.Greater(t, after, before, "imgpreview_resize_requests_total did not increase after a resize")
+	})
+}
+
+// fetchMetricValue запрашивает /metrics и суммирует значения всех серий с заданным именем метрики
+// (без учёта меток), чтобы не привязываться к конкретному набору label-значений.
+func fetchMetricValue(t *testing.T, client http.Client, metricsURL, metricName string) float64 {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", metricsURL, nil)
+	require.NoError(t, err, "Failed to create metrics request")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err, "Metrics request failed")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "Unexpected /metrics status code")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "Failed to read /metrics body")
+
+	var total float64
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "#") || !strings.HasPrefix(line, metricName) {
+			continue
+		}
+		fields := strings.Fields(line)
+		require.Len(t, fields, 2, "Unexpected metric line format: %q", line)
+		value, err := strconv.ParseFloat(fields[1], 64)
+		require.NoError(t, err, "Failed to parse metric value: %q", line)
+		total += value
+	}
+
+	return total
+}
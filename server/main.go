@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/grunsh/imgPreview/internal/cache"
+	"github.com/grunsh/imgPreview/internal/metrics"
+	"github.com/grunsh/imgPreview/internal/processor"
+)
+
+func main() {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	capacity := 100
+	if v := os.Getenv("CACHE_CAPACITY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			capacity = n
+		}
+	}
+
+	imgCache := cache.NewLRUCache(capacity)
+	reg := prometheus.NewRegistry()
+	imgMetrics := metrics.New(reg)
+	imgProcessor := processor.NewImageProcessor(imgCache, imgMetrics)
+
+	resizeHandler := newResizeHandler(imgProcessor)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/fill/", resizeHandler)
+	mux.HandleFunc("/fit/", resizeHandler)
+	mux.HandleFunc("/thumbnail/", resizeHandler)
+	mux.HandleFunc("/crop/", resizeHandler)
+
+	log.Printf("listening on :%s", port)
+	if err := http.ListenAndServe(":"+port, mux); err != nil {
+		log.Fatalf("server failed: %v", err)
+	}
+}
+
+func handleHealth(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}